@@ -3,6 +3,7 @@ package runtime
 import (
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -10,6 +11,8 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -44,39 +47,79 @@ func (d *Net) Match(path string) bool {
 
 // GenerateDockerfile generates a multi-stage Dockerfile for a .NET project.
 func (d *Net) GenerateDockerfile(path string, data ...map[string]string) ([]byte, error) {
+	var overrides map[string]string
+	if len(data) > 0 {
+		overrides = data[0]
+	}
+
 	// 1. 查找 .NET SDK 版本
-	version, err := findNetVersion(path, d.Log)
+	versionInfo, err := findNetVersion(path, d.Log)
 	if err != nil {
 		return nil, err
 	}
 
-	// 2. 查找主项目文件 (用于 dotnet publish)
-	projectFile, err := findProjectFile(path)
+	// 2. 枚举仓库中的全部项目文件 (用于逐个 COPY 以复用 Docker 层缓存)
+	allProjects, err := allProjectFiles(path)
 	if err != nil {
-		// 如果未找到，我们仍然可以继续，但会在 Dockerfile 中使用通配符或警告
-		d.Log.Warn(fmt.Sprintf("Could not locate a single main project file: %v. Using '*' as placeholder.", err))
-		projectFile = "" // 在 Dockerfile 中可能使用 . 或通配符
+		d.Log.Warn(fmt.Sprintf("Could not locate any .NET project file: %v", err))
+		allProjects = nil
+	}
+
+	// 3. 在多项目仓库中选出用于 dotnet publish 的入口项目
+	// 找不到入口项目时没有安全的占位符可用 (空字符串会生成 `dotnet publish ""` 这类无法构建的
+	// Dockerfile)，因此直接把错误返回给调用方，而不是警告后继续生成残缺的输出。
+	projectFile, err := findProjectFile(path, overrides)
+	if err != nil {
+		return nil, fmt.Errorf("could not determine entry project: %w", err)
+	}
+	projectName := strings.TrimSuffix(filepath.Base(projectFile), filepath.Ext(projectFile))
+
+	// 3b. 解析发布模式 (framework-dependent/self-contained/trimmed/aot) 及目标 RID
+	selected, _ := loadProjectInfo(path, projectFile)
+	publishMode := resolvePublishMode(overrides["PublishMode"], selected, versionInfo, d.Log)
+	rid := overrides["RID"]
+	if rid == "" {
+		rid = defaultRID
 	}
 
 	d.Log.Info(
-		fmt.Sprintf(`Detected .NET defaults 
+		fmt.Sprintf(`Detected .NET defaults
   .NET SDK Version: %s
   Project File    : %s
-`, *version, projectFile),
+  Publish Mode    : %s
+`, versionInfo.Tag, projectFile, publishMode),
 	)
 
-	// 3. 准备模板数据
+	// 3c. 解析容器暴露的端口
+	port, err := resolvePort(path, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. 准备模板数据
 	templateData := map[string]string{
-		"Version":     *version,
-		"ProjectFile": projectFile,
-		"PublishDir":  "/app/publish",
-		"Port":        getPort(),
+		"Version":          versionInfo.imageTag(),
+		"ProjectFile":      projectFile,
+		"ProjectName":      projectName,
+		"CopyProjects":     copyProjectsBlock(allProjects),
+		"PublishDir":       "/app/publish",
+		"Port":             port,
+		"PublishMode":      publishMode,
+		"RID":              rid,
+		"PublishExtraArgs": publishExtraArgs(publishMode, rid),
+		"SdkImage":         sdkImage(versionInfo),
+		"RuntimeImage":     runtimeImage(publishMode, versionInfo),
+		"Entrypoint":       entrypoint(publishMode, projectName),
 	}
-	if len(data) > 0 {
-		maps.Copy(templateData, data[0])
+	if versionInfo.RollForward != "" {
+		templateData["RollForward"] = versionInfo.RollForward
+	}
+	if versionInfo.Legacy {
+		templateData["Legacy"] = "true"
 	}
+	maps.Copy(templateData, overrides)
 
-	// 4. 解析并执行模板
+	// 5. 解析并执行模板
 	tmpl, err := template.New("Dockerfile").Parse(netTemplate)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse .NET template: %w", err)
@@ -90,10 +133,154 @@ func (d *Net) GenerateDockerfile(path string, data ...map[string]string) ([]byte
 	return buf.Bytes(), nil
 }
 
-func getPort() string {
+// defaultPort is used when no port can be discovered anywhere and the caller hasn't
+// opted into the interactive prompt.
+const defaultPort = "8080"
+
+// PortPromptError wraps a failure from the interactive port prompt (e.g. the user
+// aborted with Ctrl-C) so callers can distinguish it from other GenerateDockerfile
+// errors instead of receiving the prompt's error text disguised as a port number.
+type PortPromptError struct {
+	Err error
+}
+
+func (e *PortPromptError) Error() string {
+	return fmt.Sprintf("failed to read port from prompt: %v", e.Err)
+}
+
+func (e *PortPromptError) Unwrap() error {
+	return e.Err
+}
+
+// applicationURLPortRegex pulls the :<port> off a launchSettings.json applicationUrl
+// or an ASPNETCORE_URLS value. For a ';'-separated list such as
+// "https://localhost:5001;http://localhost:5000" the first URL's port (5001) matches.
+var applicationURLPortRegex = regexp.MustCompile(`:(\d+)(?:/|;|$)`)
+
+// resolvePort determines the port to EXPOSE, in priority order: an explicit "Port"
+// override, the project's own launchSettings.json/csproj configuration, the
+// ASPNETCORE_HTTP_PORTS/ASPNETCORE_URLS environment variables, then an interactive
+// prompt (only when opted in via "Interactive" and on a real TTY), and otherwise a
+// silent default of 8080. This keeps the generator safe to run unattended in CI.
+func resolvePort(path string, overrides map[string]string) (string, error) {
+	if port := overrides["Port"]; port != "" {
+		return port, nil
+	}
+	if port, ok := portFromProjectConfig(path); ok {
+		return port, nil
+	}
+	if port, ok := portFromEnvironment(); ok {
+		return port, nil
+	}
+	if overrides["Interactive"] == "true" && isInteractiveTerminal() {
+		port, err := promptForPort()
+		if err != nil {
+			return "", &PortPromptError{Err: err}
+		}
+		return port, nil
+	}
+	return defaultPort, nil
+}
+
+// portFromProjectConfig inspects Properties/launchSettings.json (the standard
+// location dotnet new/Visual Studio writes applicationUrl into) and falls back to a
+// bare <ApplicationUrl> element in any csproj at the repository root.
+func portFromProjectConfig(path string) (string, bool) {
+	if port, ok := portFromLaunchSettings(filepath.Join(path, "Properties", "launchSettings.json")); ok {
+		return port, true
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(path, "*.csproj"))
+	for _, match := range matches {
+		content, err := os.ReadFile(match)
+		if err != nil {
+			continue
+		}
+		var proj struct {
+			PropertyGroups []struct {
+				ApplicationURL string `xml:"ApplicationUrl"`
+			} `xml:"PropertyGroup"`
+		}
+		if err := xml.Unmarshal(content, &proj); err != nil {
+			continue
+		}
+		for _, pg := range proj.PropertyGroups {
+			if pg.ApplicationURL == "" {
+				continue
+			}
+			if m := applicationURLPortRegex.FindStringSubmatch(pg.ApplicationURL); m != nil {
+				return m[1], true
+			}
+		}
+	}
+	return "", false
+}
+
+// launchSettings is the subset of Properties/launchSettings.json we care about: each
+// profile may declare its own applicationUrl (e.g. "https://localhost:5001;http://localhost:5000").
+type launchSettings struct {
+	Profiles map[string]struct {
+		ApplicationURL string `json:"applicationUrl"`
+	} `json:"profiles"`
+}
+
+// portFromLaunchSettings reads pathToFile and returns the port from the first profile,
+// in order of profile name, that declares an applicationUrl.
+func portFromLaunchSettings(pathToFile string) (string, bool) {
+	f, err := os.Open(pathToFile)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	var settings launchSettings
+	if err := json.NewDecoder(f).Decode(&settings); err != nil {
+		return "", false
+	}
+	names := make([]string, 0, len(settings.Profiles))
+	for name := range settings.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if m := applicationURLPortRegex.FindStringSubmatch(settings.Profiles[name].ApplicationURL); m != nil {
+			return m[1], true
+		}
+	}
+	return "", false
+}
+
+// portFromEnvironment honors the same environment variables `dotnet run` itself
+// reacts to: ASPNETCORE_HTTP_PORTS (a plain, possibly ';'-separated port list) takes
+// precedence over ASPNETCORE_URLS (a list of full URLs) when both are set.
+func portFromEnvironment() (string, bool) {
+	if ports := os.Getenv("ASPNETCORE_HTTP_PORTS"); ports != "" {
+		return strings.SplitN(ports, ";", 2)[0], true
+	}
+	if urls := os.Getenv("ASPNETCORE_URLS"); urls != "" {
+		if m := applicationURLPortRegex.FindStringSubmatch(urls); m != nil {
+			return m[1], true
+		}
+	}
+	return "", false
+}
+
+// isInteractiveTerminal reports whether stdin is attached to a real terminal, so the
+// interactive prompt is never triggered accidentally under CI or when piped.
+func isInteractiveTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// promptForPort asks the user for a port interactively. Only reached when the caller
+// explicitly opted in (overrides["Interactive"] == "true") and stdin is a TTY.
+func promptForPort() (string, error) {
 	validate := func(input string) error {
 		if input == "" {
-			return errors.New("invalid subscription id")
+			return errors.New("port must not be empty")
 		}
 		return nil
 	}
@@ -103,76 +290,586 @@ func getPort() string {
 		Validate: validate,
 	}
 
-	result, err := prompt.Run()
+	return prompt.Run()
+}
+
+// findProjectFile locates the project to hand to `dotnet publish`, returned as a path
+// relative to the repository root (e.g. "src/MyApi/MyApi.csproj"). An explicit
+// "ProjectFile" override always wins. Otherwise, in a single-project repository the
+// lone project file wins outright; in a multi-project repository it narrows the
+// candidates down to the ones that are actually runnable (OutputType Exe/WinExe, or a
+// Web/Worker SDK) and, when more than one qualifies, asks the user to choose — but
+// only when running interactively (see selectProjectFile) — rather than silently
+// picking the first glob hit.
+func findProjectFile(path string, overrides map[string]string) (string, error) {
+	if explicit := overrides["ProjectFile"]; explicit != "" {
+		return explicit, nil
+	}
 
+	all, err := allProjectFiles(path)
 	if err != nil {
-		return err.Error()
+		return "", err
+	}
+	if len(all) == 1 {
+		return all[0], nil
 	}
 
-	return result
+	var runnable []string
+	for _, rel := range all {
+		info, err := loadProjectInfo(path, rel)
+		if err != nil {
+			continue
+		}
+		if info.isRunnable() {
+			runnable = append(runnable, rel)
+		}
+	}
+
+	switch len(runnable) {
+	case 0:
+		return "", errors.New("no runnable project found among multiple project files")
+	case 1:
+		return runnable[0], nil
+	default:
+		if overrides["Interactive"] == "true" && isInteractiveTerminal() {
+			return selectProjectFile(runnable)
+		}
+		return "", fmt.Errorf(
+			"multiple runnable projects found (%s); pass the \"ProjectFile\" override or opt into \"Interactive\" to choose one",
+			strings.Join(runnable, ", "),
+		)
+	}
 }
 
-// findProjectFile attempts to locate the primary .NET project file.
-func findProjectFile(path string) (string, error) {
-	patterns := []string{"*.csproj", "*.fsproj", "*.vbproj"}
-	for _, pattern := range patterns {
+// allProjectFiles enumerates every project file in the repository, relative to path.
+// When a .sln is present its project references take precedence over a flat glob so
+// that directory layout and solution membership are respected.
+func allProjectFiles(path string) ([]string, error) {
+	if solutions, _ := filepath.Glob(filepath.Join(path, "*.sln")); len(solutions) > 0 {
+		if rels, err := projectPathsFromSolution(solutions[0]); err == nil {
+			return rels, nil
+		}
+	}
+
+	var all []string
+	for _, pattern := range []string{"*.csproj", "*.fsproj", "*.vbproj"} {
 		matches, err := filepath.Glob(filepath.Join(path, pattern))
-		if err == nil && len(matches) > 0 {
-			// 找到一个就返回，通常在单项目仓库中这是正确的选择
-			fileName := filepath.Base(matches[0])
-			// 移除文件后缀
-			return strings.TrimSuffix(fileName, filepath.Ext(fileName)), nil
+		if err != nil {
+			continue
+		}
+		for _, m := range matches {
+			rel, err := filepath.Rel(path, m)
+			if err != nil {
+				rel = filepath.Base(m)
+			}
+			all = append(all, rel)
+		}
+	}
+	if len(all) == 0 {
+		return nil, errors.New("no .NET project file found")
+	}
+	return all, nil
+}
+
+// selectProjectFile prompts the user to pick the entry project when multiple
+// runnable candidates are found, instead of silently publishing the first one.
+func selectProjectFile(candidates []string) (string, error) {
+	prompt := promptui.Select{
+		Label: "Select the project to publish",
+		Items: candidates,
+	}
+	_, result, err := prompt.Run()
+	if err != nil {
+		return "", fmt.Errorf("failed to select project: %w", err)
+	}
+	return result, nil
+}
+
+// projectInfo holds the MSBuild metadata needed to decide whether a project is a
+// runnable entry point (as opposed to a class library referenced by one) and which
+// publish mode it has already opted into.
+type projectInfo struct {
+	Sdk            string // Microsoft.NET.Sdk, Microsoft.NET.Sdk.Web, Microsoft.NET.Sdk.Worker, ...
+	OutputType     string // Exe, WinExe, Library (MSBuild defaults to Library when unset)
+	PublishAot     bool   // <PublishAot>true</PublishAot>
+	PublishTrimmed bool   // <PublishTrimmed>true</PublishTrimmed>
+}
+
+// loadProjectInfo parses relPath (relative to root) and extracts the metadata needed
+// to select an entry project and to auto-detect its publish mode.
+func loadProjectInfo(root, relPath string) (*projectInfo, error) {
+	content, err := os.ReadFile(filepath.Join(root, relPath))
+	if err != nil {
+		return nil, err
+	}
+	var proj msbuildProject
+	if err := xml.Unmarshal(content, &proj); err != nil {
+		return nil, err
+	}
+
+	info := &projectInfo{Sdk: proj.Sdk}
+	for _, pg := range proj.PropertyGroups {
+		if pg.OutputType != "" {
+			info.OutputType = pg.OutputType
+		}
+		if strings.EqualFold(pg.PublishAot, "true") {
+			info.PublishAot = true
+		}
+		if strings.EqualFold(pg.PublishTrimmed, "true") {
+			info.PublishTrimmed = true
+		}
+	}
+	return info, nil
+}
+
+// isRunnable reports whether a project produces something dotnet can run directly:
+// an explicit Exe/WinExe output, or an SDK (Web, Worker) that implies one.
+func (p *projectInfo) isRunnable() bool {
+	switch strings.ToLower(p.OutputType) {
+	case "exe", "winexe":
+		return true
+	}
+	switch p.Sdk {
+	case "Microsoft.NET.Sdk.Web", "Microsoft.NET.Sdk.Worker":
+		return true
+	}
+	return false
+}
+
+// copyProjectsBlock renders one `COPY` instruction per project file, preserving its
+// directory layout, so `dotnet restore` can run against a cache-friendly layer that
+// only invalidates when a project file (not the whole source tree) changes.
+func copyProjectsBlock(projectFiles []string) string {
+	lines := make([]string, 0, len(projectFiles))
+	for _, rel := range projectFiles {
+		dir := filepath.ToSlash(filepath.Dir(rel))
+		if dir == "." {
+			lines = append(lines, fmt.Sprintf("COPY %s ./", filepath.ToSlash(rel)))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("COPY %s %s/", filepath.ToSlash(rel), dir))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Publish modes accepted via the "PublishMode" override, mirroring the `dotnet publish`
+// flags they expand into.
+const (
+	PublishModeFrameworkDependent = "framework-dependent"
+	PublishModeSelfContained      = "self-contained"
+	PublishModeTrimmed            = "trimmed"
+	PublishModeAOT                = "aot"
+)
+
+// defaultRID is the runtime identifier used for self-contained/trimmed/AOT publishes
+// when no "RID" override is supplied. linux-x64 covers the common Debian/Ubuntu-based
+// official images; musl (Alpine) or arm64 targets must opt in via the override.
+const defaultRID = "linux-x64"
+
+// resolvePublishMode determines the publish mode to use: an explicit override always
+// wins, otherwise the selected project is inspected for an existing opt-in
+// (<PublishAot>/<PublishTrimmed>) so that repositories which already configure one of
+// these get the matching Dockerfile stage without extra flags. AOT requires .NET 8+;
+// older SDKs requesting it are downgraded to self-contained with a warning.
+func resolvePublishMode(override string, info *projectInfo, versionInfo *netVersionInfo, log *slog.Logger) string {
+	mode := override
+	if mode == "" {
+		switch {
+		case info != nil && info.PublishAot:
+			mode = PublishModeAOT
+		case info != nil && info.PublishTrimmed:
+			mode = PublishModeTrimmed
+		default:
+			mode = PublishModeFrameworkDependent
 		}
 	}
-	return "", errors.New("no .NET project file found")
+
+	if versionInfo.Legacy {
+		if mode != PublishModeFrameworkDependent {
+			log.Warn(fmt.Sprintf("PublishMode %q is not supported for .NET Framework (%s). Using framework-dependent.", mode, versionInfo.Tag))
+		}
+		return PublishModeFrameworkDependent
+	}
+
+	if mode == PublishModeAOT {
+		if major, _ := splitMajorMinor(versionInfo.Tag); major < 8 {
+			log.Warn(fmt.Sprintf("PublishAot requires .NET 8+, but detected %s. Falling back to self-contained.", versionInfo.Tag))
+			return PublishModeSelfContained
+		}
+	}
+	return mode
+}
+
+// publishExtraArgs renders the extra `dotnet publish` flags for the given publish mode.
+func publishExtraArgs(mode, rid string) string {
+	switch mode {
+	case PublishModeSelfContained:
+		return fmt.Sprintf(" -r %s --self-contained true", rid)
+	case PublishModeTrimmed:
+		return fmt.Sprintf(" -r %s --self-contained true -p:PublishTrimmed=true", rid)
+	case PublishModeAOT:
+		return fmt.Sprintf(" -r %s -p:PublishAot=true", rid)
+	default:
+		return ""
+	}
+}
+
+// sdkImage picks the build-stage base image. .NET Framework (Legacy) has no official
+// `dotnet/sdk` image — it ships under the separate `dotnet/framework/sdk` repository
+// and only runs on Windows containers — so it gets its own image family regardless of
+// publish mode (resolvePublishMode already forces Legacy projects to framework-dependent).
+func sdkImage(versionInfo *netVersionInfo) string {
+	if versionInfo.Legacy {
+		return fmt.Sprintf("mcr.microsoft.com/dotnet/framework/sdk:%s", versionInfo.imageTag())
+	}
+	return fmt.Sprintf("mcr.microsoft.com/dotnet/sdk:%s", versionInfo.imageTag())
+}
+
+// runtimeImage picks the base image for the final stage. .NET Framework always uses
+// the Windows-only `dotnet/framework/aspnet` image. For modern .NET, framework-dependent
+// publishes need the ASP.NET/runtime image to host the app; self-contained, trimmed, and
+// AOT publishes ship their own runtime and only need the OS dependencies, so they run
+// on the much smaller `runtime-deps` image (chiseled for AOT, for the smallest footprint).
+func runtimeImage(mode string, versionInfo *netVersionInfo) string {
+	tag := versionInfo.imageTag()
+	if versionInfo.Legacy {
+		return fmt.Sprintf("mcr.microsoft.com/dotnet/framework/aspnet:%s", tag)
+	}
+	switch mode {
+	case PublishModeSelfContained, PublishModeTrimmed:
+		return fmt.Sprintf("mcr.microsoft.com/dotnet/runtime-deps:%s-bookworm-slim", tag)
+	case PublishModeAOT:
+		return fmt.Sprintf("mcr.microsoft.com/dotnet/runtime-deps:%s-jammy-chiseled", tag)
+	default:
+		return fmt.Sprintf("mcr.microsoft.com/dotnet/aspnet:%s", tag)
+	}
+}
+
+// entrypoint renders the ENTRYPOINT instruction for the given publish mode. Framework-
+// dependent publishes run the DLL through the `dotnet` host; the other modes publish a
+// native executable that is invoked directly.
+func entrypoint(mode, projectName string) string {
+	switch mode {
+	case PublishModeSelfContained, PublishModeTrimmed, PublishModeAOT:
+		return fmt.Sprintf(`["./%s"]`, projectName)
+	default:
+		return fmt.Sprintf(`["dotnet", "%s.dll"]`, projectName)
+	}
+}
+
+// netVersionInfo 汇总了从仓库中探测到的 .NET 版本信息，用于填充 Dockerfile 模板。
+type netVersionInfo struct {
+	Tag         string // mcr.microsoft.com/dotnet 镜像使用的 major.minor 标签，如 "8.0"
+	FullVersion string // global.json 中固定的完整 sdk.version (如 "8.0.403")，仅 rollForward=disable 时需要
+	RollForward string // global.json 中声明的 rollForward 策略，未声明时为空
+	Legacy      bool   // 是否为 .NET Framework（经典版），无法使用官方 dotnet/sdk 运行时镜像
+}
+
+// imageTag 根据 RollForward 策略把探测到的版本折算成镜像标签使用的版本号：
+// disable 要求精确匹配 global.json 固定的 SDK 版本，必须使用完整版本号而非 major.minor 的浮动标签；
+// latestMajor 允许跨次要版本升级，使用仅 major 的浮动标签；其余策略 (latestFeature/latestMinor/未声明)
+// 已经是 major.minor 浮动标签，维持现状即可。
+func (v *netVersionInfo) imageTag() string {
+	switch v.RollForward {
+	case "disable":
+		if v.FullVersion != "" {
+			return v.FullVersion
+		}
+	case "latestMajor":
+		if major, _ := splitMajorMinor(v.Tag); major > 0 {
+			return strconv.Itoa(major)
+		}
+	}
+	return v.Tag
 }
 
 // findNetVersion determines the .NET SDK version from project metadata.
-func findNetVersion(path string, log *slog.Logger) (*string, error) {
-	// 1. 检查 global.json 文件
-	globalJsonPath := filepath.Join(path, "global.json")
-	if _, err := os.Stat(globalJsonPath); err == nil {
-		var globalJSON struct {
-			SDK struct {
-				Version string `json:"version"`
-			} `json:"sdk"`
-		}
-		f, err := os.Open(globalJsonPath)
-		if err == nil {
-			defer f.Close()
-			if json.NewDecoder(f).Decode(&globalJSON) == nil && globalJSON.SDK.Version != "" {
-				// global.json 提供了完整的语义版本，我们提取 Major.Minor 部分作为 Docker 标签
-				if majorMinor := extractMajorMinor(globalJSON.SDK.Version); majorMinor != "" {
-					log.Info("Detected .NET SDK version from global.json: " + majorMinor)
-					return &majorMinor, nil
-				}
+//
+// 探测顺序沿用 Starship dotnet 模块的启发式：global.json > Directory.Build.props >
+// Directory.Build.targets > Packages.props > *.sln > *.csproj/*.fsproj/*.vbproj/*.xproj >
+// project.json，命中第一个即停止。
+func findNetVersion(path string, log *slog.Logger) (*netVersionInfo, error) {
+	// 1. global.json：固定的 SDK 版本 (可选 rollForward 策略) 优先级最高
+	if g, err := parseGlobalJSON(filepath.Join(path, "global.json")); err == nil {
+		tag := extractMajorMinor(g.SDK.Version)
+		log.Info("Detected .NET SDK version from global.json: " + tag)
+		return &netVersionInfo{Tag: tag, FullVersion: g.SDK.Version, RollForward: g.SDK.RollForward}, nil
+	}
+
+	// 2-4. Directory.Build.props / Directory.Build.targets / Packages.props：
+	// 多项目仓库常在这些根级文件中统一声明 TargetFramework(s)
+	for _, name := range []string{"Directory.Build.props", "Directory.Build.targets", "Packages.props"} {
+		if moniker, err := targetFrameworkFromMSBuild(filepath.Join(path, name)); err == nil {
+			if info := newNetVersionInfo(moniker); info != nil {
+				log.Info("Detected .NET target framework from " + name + ": " + moniker)
+				return info, nil
 			}
 		}
 	}
 
-	// 2. 检查项目文件中的 TargetFramework
-	patterns := []string{"*.csproj", "*.fsproj", "*.vbproj"}
-	// 匹配 <TargetFramework>netX.Y</TargetFramework>
-	regex := regexp.MustCompile(`<TargetFramework>net([\d\.]+)</TargetFramework>`)
+	// 5. *.sln：解决方案文件本身不声明框架，但可以引导我们找到其引用的第一个项目文件
+	if solutions, _ := filepath.Glob(filepath.Join(path, "*.sln")); len(solutions) > 0 {
+		if projectPaths, err := projectPathsFromSolution(solutions[0]); err == nil {
+			for _, rel := range projectPaths {
+				if moniker, err := targetFrameworkFromMSBuild(filepath.Join(path, rel)); err == nil {
+					if info := newNetVersionInfo(moniker); info != nil {
+						log.Info("Detected .NET target framework via " + filepath.Base(solutions[0]) + ": " + moniker)
+						return info, nil
+					}
+				}
+			}
+		}
+	}
 
-	for _, pattern := range patterns {
+	// 6. *.csproj / *.fsproj / *.vbproj / *.xproj：单项目仓库中最常见的来源
+	for _, pattern := range []string{"*.csproj", "*.fsproj", "*.vbproj", "*.xproj"} {
 		matches, _ := filepath.Glob(filepath.Join(path, pattern))
 		for _, match := range matches {
-			content, err := os.ReadFile(match)
-			if err == nil {
-				if submatches := regex.FindStringSubmatch(string(content)); len(submatches) > 1 {
-					version := submatches[1] // e.g., "8.0", "7.0"
-					log.Info("Detected .NET TargetFramework from " + filepath.Base(match) + ": " + version)
-					return &version, nil
+			if moniker, err := targetFrameworkFromMSBuild(match); err == nil {
+				if info := newNetVersionInfo(moniker); info != nil {
+					log.Info("Detected .NET TargetFramework from " + filepath.Base(match) + ": " + moniker)
+					return info, nil
 				}
 			}
 		}
 	}
 
-	// 3. 默认值
-	defaultVersion := "8.0" // 使用最新的 LTS 版本作为默认值
-	log.Info("No .NET version detected. Using default LTS: " + defaultVersion)
-	return &defaultVersion, nil
+	// 7. project.json：pre-1.0 时代的 .NET Core 项目格式
+	if moniker, err := targetFrameworkFromProjectJSON(filepath.Join(path, "project.json")); err == nil {
+		if info := newNetVersionInfo(moniker); info != nil {
+			log.Info("Detected .NET target framework from project.json: " + moniker)
+			return info, nil
+		}
+	}
+
+	// 8. 默认值
+	defaultTag := "8.0" // 使用最新的 LTS 版本作为默认值
+	log.Info("No .NET version detected. Using default LTS: " + defaultTag)
+	return &netVersionInfo{Tag: defaultTag}, nil
+}
+
+// newNetVersionInfo 将探测到的目标框架 moniker 解析为镜像标签。moniker 无法识别时返回 nil，
+// 让调用方继续尝试优先级列表中的下一个来源。
+func newNetVersionInfo(moniker string) *netVersionInfo {
+	tag, legacy := resolveDotnetTag(moniker)
+	if tag == "" {
+		return nil
+	}
+	return &netVersionInfo{Tag: tag, Legacy: legacy}
+}
+
+// globalJSONFile 是 global.json 中我们关心的子集。
+type globalJSONFile struct {
+	SDK struct {
+		Version     string `json:"version"`
+		RollForward string `json:"rollForward"` // latestFeature | latestMinor | latestMajor | disable
+	} `json:"sdk"`
+}
+
+// parseGlobalJSON 读取并解析 global.json，要求其中声明了 sdk.version。
+func parseGlobalJSON(pathToFile string) (*globalJSONFile, error) {
+	f, err := os.Open(pathToFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var g globalJSONFile
+	if err := json.NewDecoder(f).Decode(&g); err != nil {
+		return nil, err
+	}
+	if g.SDK.Version == "" {
+		return nil, errors.New("global.json has no sdk.version")
+	}
+	return &g, nil
+}
+
+// msbuildProject 是 .csproj/.fsproj/.vbproj/.xproj 以及 Directory.Build.props 等 MSBuild XML
+// 文件的最小化结构，只保留版本探测和项目选择需要用到的字段。
+type msbuildProject struct {
+	Sdk            string `xml:"Sdk,attr"` // Microsoft.NET.Sdk.Web, Microsoft.NET.Sdk.Worker, ...
+	PropertyGroups []struct {
+		TargetFramework        string `xml:"TargetFramework"`
+		TargetFrameworks       string `xml:"TargetFrameworks"`
+		TargetFrameworkVersion string `xml:"TargetFrameworkVersion"`
+		OutputType             string `xml:"OutputType"`
+		PublishAot             string `xml:"PublishAot"`
+		PublishTrimmed         string `xml:"PublishTrimmed"`
+	} `xml:"PropertyGroup"`
+}
+
+// targetFrameworkFromMSBuild 解析一个 MSBuild XML 文件，返回其中声明的目标框架 moniker。
+// 多目标 (TargetFrameworks) 的项目按 highestFramework 选出版本最高的一个。
+func targetFrameworkFromMSBuild(pathToFile string) (string, error) {
+	content, err := os.ReadFile(pathToFile)
+	if err != nil {
+		return "", err
+	}
+
+	var proj msbuildProject
+	if err := xml.Unmarshal(content, &proj); err != nil {
+		return "", err
+	}
+
+	for _, pg := range proj.PropertyGroups {
+		if pg.TargetFrameworks != "" {
+			if moniker := highestFramework(pg.TargetFrameworks); moniker != "" {
+				return moniker, nil
+			}
+		}
+		if pg.TargetFramework != "" {
+			return pg.TargetFramework, nil
+		}
+		if pg.TargetFrameworkVersion != "" {
+			return pg.TargetFrameworkVersion, nil
+		}
+	}
+	return "", errors.New("no TargetFramework(s) declared")
+}
+
+// legacyProjectJSON 是 project.json (pre-1.0 .NET Core) 中我们关心的子集。
+type legacyProjectJSON struct {
+	Frameworks map[string]json.RawMessage `json:"frameworks"`
+}
+
+// targetFrameworkFromProjectJSON 解析 project.json 的 "frameworks" 字段，返回版本最高的 moniker。
+func targetFrameworkFromProjectJSON(pathToFile string) (string, error) {
+	f, err := os.Open(pathToFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var p legacyProjectJSON
+	if err := json.NewDecoder(f).Decode(&p); err != nil {
+		return "", err
+	}
+	if len(p.Frameworks) == 0 {
+		return "", errors.New("project.json declares no frameworks")
+	}
+
+	monikers := make([]string, 0, len(p.Frameworks))
+	for moniker := range p.Frameworks {
+		monikers = append(monikers, moniker)
+	}
+	moniker := highestFramework(strings.Join(monikers, ";"))
+	if moniker == "" {
+		return "", errors.New("project.json frameworks are unrecognized")
+	}
+	return moniker, nil
+}
+
+// slnProjectLineRegex 匹配 .sln 文件中引用项目的行，例如：
+// Project("{FAE04EC0-301F-11D3-BF4B-00C04F79EFBC}") = "MyApp", "src\MyApp\MyApp.csproj", "{GUID}"
+var slnProjectLineRegex = regexp.MustCompile(`^Project\("\{[0-9A-Fa-f-]+\}"\)\s*=\s*"[^"]*",\s*"([^"]+\.(?:csproj|fsproj|vbproj))"`)
+
+// projectPathsFromSolution 从 .sln 文件中提取其引用的 csproj/fsproj/vbproj 相对路径。
+func projectPathsFromSolution(pathToFile string) ([]string, error) {
+	content, err := os.ReadFile(pathToFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if m := slnProjectLineRegex.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			paths = append(paths, filepath.FromSlash(strings.ReplaceAll(m[1], `\`, "/")))
+		}
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("no project references found in solution")
+	}
+	return paths, nil
+}
+
+// highestFramework 从以 ';' 分隔的 TargetFrameworks (或 project.json frameworks 键名) 列表中
+// 选出版本最高的 moniker，多目标项目与 Starship 采用同样的“选最新”策略。
+func highestFramework(raw string) string {
+	best, bestTag := "", ""
+	for _, moniker := range strings.Split(raw, ";") {
+		moniker = strings.TrimSpace(moniker)
+		if moniker == "" {
+			continue
+		}
+		tag, _ := resolveDotnetTag(moniker)
+		if tag == "" {
+			continue
+		}
+		if bestTag == "" || compareVersions(tag, bestTag) > 0 {
+			best, bestTag = moniker, tag
+		}
+	}
+	return best
+}
+
+// compareVersions 逐段比较两个以 '.' 分隔的版本号 (如 "8.0" 或 "4.7.2")，a 更新时返回正数。
+func compareVersions(a, b string) int {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var x, y int
+		if i < len(aParts) {
+			x, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			y, _ = strconv.Atoi(bParts[i])
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+func splitMajorMinor(v string) (major, minor int) {
+	parts := strings.SplitN(v, ".", 2)
+	major, _ = strconv.Atoi(parts[0])
+	if len(parts) > 1 {
+		minor, _ = strconv.Atoi(parts[1])
+	}
+	return major, minor
+}
+
+// resolveDotnetTag 将目标框架 moniker (或 TargetFrameworkVersion) 解析为
+// mcr.microsoft.com/dotnet 镜像使用的 major.minor 标签 (.NET Framework 的 3 位 moniker
+// 和 TargetFrameworkVersion 会保留 build 号，如 net472 -> 4.7.2)，并标明该 moniker 是否属于
+// .NET Framework（经典版），这类项目无法使用官方 dotnet/{sdk,aspnet,runtime} 镜像。
+func resolveDotnetTag(moniker string) (tag string, legacy bool) {
+	moniker = strings.ToLower(strings.TrimSpace(moniker))
+
+	switch {
+	case strings.HasPrefix(moniker, "netcoreapp"):
+		return strings.TrimPrefix(moniker, "netcoreapp"), false
+	case strings.HasPrefix(moniker, "netstandard"):
+		return strings.TrimPrefix(moniker, "netstandard"), false
+	case strings.HasPrefix(moniker, "net") && strings.Contains(moniker, "."):
+		// net5.0, net6.0, net7.0, net8.0, ... (统一后的现代 .NET)
+		return strings.TrimPrefix(moniker, "net"), false
+	case strings.HasPrefix(moniker, "net"):
+		// net48, net40, ... (2 位: major+minor) 以及 net472, net481, ... (3 位:
+		// major+minor+build，.NET Framework 4.6.1 之后新增的补丁号) 的无点号 moniker
+		digits := strings.TrimPrefix(moniker, "net")
+		if len(digits) < 2 || !isDigits(digits) {
+			return "", false
+		}
+		tag = digits[:1] + "." + digits[1:2]
+		if len(digits) > 2 {
+			tag += "." + digits[2:]
+		}
+		return tag, true
+	case strings.HasPrefix(moniker, "v"):
+		// TargetFrameworkVersion 形式，例如 v4.8, v4.7.2
+		return strings.TrimPrefix(moniker, "v"), true
+	}
+	return "", false
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
 }
 
 // extractMajorMinor 从语义版本中提取 Major.Minor (例如: "8.0.100" -> "8.0", "7.0.5" -> "7.0")
@@ -185,37 +882,39 @@ func extractMajorMinor(v string) string {
 }
 
 // netTemplate 是一个多阶段的 .NET Dockerfile 模板。
-// 它使用 'sdk' 镜像进行构建和发布，然后切换到更小的 'aspnet' 镜像进行运行。
+// 构建阶段始终使用 'sdk' 镜像；运行阶段的基础镜像和启动入口点随 PublishMode 变化：
+// framework-dependent 使用 'aspnet' 镜像 + `dotnet xxx.dll`，self-contained/trimmed/aot
+// 发布自带运行时，改用更小的 'runtime-deps' 镜像 + 原生可执行文件入口点 (见 runtimeImage/entrypoint)。
 var netTemplate = strings.TrimSpace(`
 # Multi-stage Dockerfile for .NET Application
 
 # -----------------
 # 1. Build Stage
 # -----------------
-# ARG NET_VERSION: .NET SDK 版本，例如 8.0
+# ARG NET_VERSION: .NET SDK 版本标签，已按 global.json 的 rollForward 策略折算{{if .RollForward}} (rollForward={{.RollForward}}){{end}}
 ARG NET_VERSION={{.Version}}
 ARG PORT={{.Port}}
-# 使用 SDK 镜像进行构建和发布
-FROM mcr.microsoft.com/dotnet/sdk:${NET_VERSION} AS build
+# 使用 SDK 镜像进行构建和发布{{if .Legacy}} (.NET Framework 经典版，需要 Windows 容器宿主){{end}}
+FROM {{.SdkImage}} AS build
 WORKDIR /src
 
-# 复制项目文件并恢复依赖
-# 假设主项目文件在根目录
-COPY *.csproj *.fsproj *.vbproj ./
+# 复制每个项目文件，保留其目录结构，这样只要项目引用不变，
+# 这一层就能被 Docker 缓存，不会因为源代码改动而失效
+{{.CopyProjects}}
 # 运行 dotnet restore，恢复依赖
-RUN dotnet restore
+RUN dotnet restore "{{.ProjectFile}}"
 
 # 复制剩余的源代码并构建
 COPY . .
-# 发布应用到 /app/publish 目录
-# {{.ProjectFile}} 变量应包含主项目文件名，如 MyWebApp.csproj
-RUN dotnet publish "{{.ProjectFile}}" -c Release -o /app/publish --no-restore
+# 发布应用到 /app/publish 目录 (PublishMode={{.PublishMode}})
+# {{.ProjectFile}} 是入口项目相对于仓库根目录的路径，如 src/MyWebApp/MyWebApp.csproj
+RUN dotnet publish "{{.ProjectFile}}" -c Release -o /app/publish --no-restore{{.PublishExtraArgs}}
 
 # -----------------
 # 2. Runtime Stage
 # -----------------
-# 使用更小、更安全的 ASP.NET Runtime 镜像
-FROM mcr.microsoft.com/dotnet/aspnet:${NET_VERSION} AS final
+# {{.RuntimeImage}}
+FROM {{.RuntimeImage}} AS final
 WORKDIR /app
 
 # 从 build 阶段复制发布的输出
@@ -227,6 +926,5 @@ ENV DOTNET_RUNNING_IN_CONTAINER=true
 EXPOSE {{.Port}}
 
 # 容器启动入口点
-# 应用程序的 DLL 文件名通常与项目文件同名，例如 MyWebApp.csproj -> MyWebApp.dll
-ENTRYPOINT ["dotnet", "{{.ProjectFile}}.dll"]
+ENTRYPOINT {{.Entrypoint}}
 `)
@@ -0,0 +1,115 @@
+package runtime
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+)
+
+// discardLogger returns a logger that writes nowhere, so tests don't spam output.
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// TestFindNetVersion_Precedence exercises findNetVersion's detection sources in
+// isolation, one fixture per source, in the order they are meant to be tried:
+// global.json > Directory.Build.props/.targets/Packages.props > *.sln > project
+// files > project.json > default LTS fallback.
+func TestFindNetVersion_Precedence(t *testing.T) {
+	cases := []struct {
+		name            string
+		fixture         string
+		wantTag         string
+		wantRollForward string
+		wantLegacy      bool
+	}{
+		{name: "global.json pins an exact SDK version", fixture: "global-json", wantTag: "8.0"},
+		{name: "global.json rollForward policy is preserved", fixture: "global-json-rollforward", wantTag: "7.0", wantRollForward: "latestMinor"},
+		{name: "Directory.Build.props TargetFramework", fixture: "directory-build-props", wantTag: "8.0"},
+		{name: ".sln resolves to its referenced project's TargetFramework", fixture: "sln", wantTag: "6.0"},
+		{name: "single csproj TargetFramework", fixture: "csproj", wantTag: "8.0"},
+		{name: "multi-targeted csproj picks the highest TargetFrameworks entry", fixture: "csproj-multitarget", wantTag: "8.0"},
+		{name: "legacy TargetFrameworkVersion maps to a .NET Framework tag", fixture: "csproj-legacy", wantTag: "4.8", wantLegacy: true},
+		{name: "dotless 3-digit legacy TargetFramework keeps its build number", fixture: "csproj-legacy-3digit", wantTag: "4.7.2", wantLegacy: true},
+		{name: "project.json frameworks (pre-1.0 .NET Core)", fixture: "project-json", wantTag: "2.0"},
+		{name: "falls back to the default LTS when nothing is detected", fixture: "empty", wantTag: "8.0"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := findNetVersion(filepath.Join("testdata", "netversion", tc.fixture), discardLogger())
+			if err != nil {
+				t.Fatalf("findNetVersion() error = %v", err)
+			}
+			if info.Tag != tc.wantTag {
+				t.Errorf("Tag = %q, want %q", info.Tag, tc.wantTag)
+			}
+			if info.RollForward != tc.wantRollForward {
+				t.Errorf("RollForward = %q, want %q", info.RollForward, tc.wantRollForward)
+			}
+			if info.Legacy != tc.wantLegacy {
+				t.Errorf("Legacy = %v, want %v", info.Legacy, tc.wantLegacy)
+			}
+		})
+	}
+}
+
+// TestFindNetVersion_SourcePrecedence sets up fixtures where two sources disagree on
+// the target framework, to verify that findNetVersion stops at the first source in
+// its priority list rather than, say, averaging or picking the highest version found.
+func TestFindNetVersion_SourcePrecedence(t *testing.T) {
+	cases := []struct {
+		name    string
+		fixture string
+		wantTag string
+	}{
+		{name: "global.json wins over Directory.Build.props and csproj", fixture: "precedence-global-vs-rest", wantTag: "6.0"},
+		{name: "Directory.Build.props wins over .sln", fixture: "precedence-props-vs-sln", wantTag: "7.0"},
+		{name: ".sln wins over an unrelated root csproj", fixture: "precedence-sln-vs-csproj", wantTag: "6.0"},
+		{name: "csproj wins over project.json", fixture: "precedence-csproj-vs-projectjson", wantTag: "8.0"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := findNetVersion(filepath.Join("testdata", "netversion", tc.fixture), discardLogger())
+			if err != nil {
+				t.Fatalf("findNetVersion() error = %v", err)
+			}
+			if info.Tag != tc.wantTag {
+				t.Errorf("Tag = %q, want %q", info.Tag, tc.wantTag)
+			}
+		})
+	}
+}
+
+// TestResolveDotnetTag_DotlessLegacyMonikers pins down the digit split for dotless
+// .NET Framework monikers: 2-digit monikers are major+minor (net48 -> 4.8), while the
+// 3-digit monikers introduced from .NET Framework 4.6.1 onward are major+minor+build
+// (net472 -> 4.7.2, not 4.72).
+func TestResolveDotnetTag_DotlessLegacyMonikers(t *testing.T) {
+	cases := []struct {
+		moniker string
+		wantTag string
+	}{
+		{moniker: "net40", wantTag: "4.0"},
+		{moniker: "net48", wantTag: "4.8"},
+		{moniker: "net461", wantTag: "4.6.1"},
+		{moniker: "net462", wantTag: "4.6.2"},
+		{moniker: "net471", wantTag: "4.7.1"},
+		{moniker: "net472", wantTag: "4.7.2"},
+		{moniker: "net481", wantTag: "4.8.1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.moniker, func(t *testing.T) {
+			tag, legacy := resolveDotnetTag(tc.moniker)
+			if tag != tc.wantTag {
+				t.Errorf("resolveDotnetTag(%q) tag = %q, want %q", tc.moniker, tag, tc.wantTag)
+			}
+			if !legacy {
+				t.Errorf("resolveDotnetTag(%q) legacy = false, want true", tc.moniker)
+			}
+		})
+	}
+}